@@ -0,0 +1,80 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// keychainService is the service name under which every backend
+// stores 2fa secrets, alongside the key name as the account.
+const keychainService = "rsc.io/2fa"
+
+// A keychainBackend stores and retrieves 2fa secrets. Each entry is
+// stored as "digits\nbase32secret", so that after retrieval the
+// existing parseKeychainKeyLine parsing still applies.
+type keychainBackend interface {
+	list() ([]string, error)
+	get(name string) (secret []byte, digits int, err error)
+	add(name string, secret []byte, digits int) error
+	remove(name string) error
+}
+
+// encodeSecretValue formats digits and secret the way every backend
+// stores them: "digits\nbase32secret".
+func encodeSecretValue(secret []byte, digits int) []byte {
+	return []byte(fmt.Sprintf("%d\n%s", digits, secret))
+}
+
+// decodeSecretValue parses a value of the form "digits\nbase32secret",
+// as produced by encodeSecretValue, reusing parseKeychainKeyLine so
+// the two forms stay in sync.
+func decodeSecretValue(name string, value []byte) (secret []byte, digits int, err error) {
+	fields := parseKeychainKeyLine(append([]byte(name+" "), value...))
+	if len(fields) != 3 {
+		return nil, 0, fmt.Errorf("malformed keyring entry for %q", name)
+	}
+	digits, err = strconv.Atoi(string(fields[1]))
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid digits for key %q: %v", name, err)
+	}
+	return fields[2], digits, nil
+}
+
+// openBackend selects the keychainBackend named by the TWOFA_KEYRING
+// environment variable: "file" (the default), "keychain",
+// "secret-service", "pass", or "wincred". When a non-file backend is
+// selected it overrides the -2fa file path entirely.
+func openBackend(file string) keychainBackend {
+	switch os.Getenv("TWOFA_KEYRING") {
+	case "", "file":
+		return newFileKeychainBackend(file)
+	case "keychain":
+		return newMacKeychainBackend()
+	case "secret-service":
+		return newSecretServiceBackend()
+	case "pass":
+		return newPassBackend()
+	case "wincred":
+		return newWincredBackend()
+	default:
+		fmt.Fprintf(os.Stderr, "2fa: unknown TWOFA_KEYRING backend %q\n", os.Getenv("TWOFA_KEYRING"))
+		os.Exit(2)
+		panic("unreachable")
+	}
+}
+
+// unsupportedBackend stands in for a platform-specific backend that
+// isn't available on the current GOOS, so selecting it fails with a
+// clear error instead of a missing-symbol build failure.
+type unsupportedBackend struct{ reason string }
+
+func (b unsupportedBackend) list() ([]string, error)         { return nil, errors.New(b.reason) }
+func (b unsupportedBackend) get(string) ([]byte, int, error) { return nil, 0, errors.New(b.reason) }
+func (b unsupportedBackend) add(string, []byte, int) error   { return errors.New(b.reason) }
+func (b unsupportedBackend) remove(string) error             { return errors.New(b.reason) }
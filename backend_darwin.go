@@ -0,0 +1,73 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// macKeychainBackend stores secrets in the macOS Keychain via the
+// "security" command-line tool, under the generic-password class.
+type macKeychainBackend struct{}
+
+func newMacKeychainBackend() *macKeychainBackend { return &macKeychainBackend{} }
+
+func (b *macKeychainBackend) get(name string) ([]byte, int, error) {
+	out, err := exec.Command("security", "find-generic-password", "-s", keychainService, "-a", name, "-w").Output()
+	if err != nil {
+		return nil, 0, fmt.Errorf("security find-generic-password %q: %v", name, err)
+	}
+	return decodeSecretValue(name, bytes.TrimRight(out, "\n"))
+}
+
+func (b *macKeychainBackend) add(name string, secret []byte, digits int) error {
+	return exec.Command("security", "add-generic-password",
+		"-s", keychainService, "-a", name, "-w", string(encodeSecretValue(secret, digits))).Run()
+}
+
+func (b *macKeychainBackend) remove(name string) error {
+	return exec.Command("security", "delete-generic-password", "-s", keychainService, "-a", name).Run()
+}
+
+// list scrapes `security dump-keychain`, since the security tool has
+// no direct "list accounts for service" query.
+func (b *macKeychainBackend) list() ([]string, error) {
+	out, err := exec.Command("security", "dump-keychain").Output()
+	if err != nil {
+		return nil, fmt.Errorf("security dump-keychain: %v", err)
+	}
+	var names []string
+	forOurService := false
+	for _, line := range strings.Split(string(out), "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, `"svce"`):
+			forOurService = strings.Contains(line, `"`+keychainService+`"`)
+		case forOurService && strings.HasPrefix(line, `"acct"`):
+			if name, ok := quotedValue(line); ok {
+				names = append(names, name)
+			}
+			forOurService = false
+		}
+	}
+	return names, nil
+}
+
+// quotedValue extracts the final double-quoted string from a
+// dump-keychain attribute line such as `"acct"<blob>="github"`.
+func quotedValue(line string) (string, bool) {
+	j := strings.LastIndexByte(line, '"')
+	if j < 0 {
+		return "", false
+	}
+	i := strings.LastIndexByte(line[:j], '"')
+	if i < 0 {
+		return "", false
+	}
+	return line[i+1 : j], true
+}
@@ -0,0 +1,59 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path"
+	"strings"
+)
+
+// passBackend stores secrets in a "pass" (https://passwordstore.org)
+// password store, one entry per key under the rsc.io/2fa directory.
+type passBackend struct{}
+
+func newPassBackend() *passBackend { return &passBackend{} }
+
+func passEntry(name string) string {
+	return path.Join(keychainService, name)
+}
+
+func (b *passBackend) get(name string) ([]byte, int, error) {
+	out, err := exec.Command("pass", "show", passEntry(name)).Output()
+	if err != nil {
+		return nil, 0, fmt.Errorf("pass show %q: %v", name, err)
+	}
+	return decodeSecretValue(name, bytes.TrimRight(out, "\n"))
+}
+
+func (b *passBackend) add(name string, secret []byte, digits int) error {
+	cmd := exec.Command("pass", "insert", "-m", "-f", passEntry(name))
+	cmd.Stdin = bytes.NewReader(encodeSecretValue(secret, digits))
+	return cmd.Run()
+}
+
+func (b *passBackend) remove(name string) error {
+	return exec.Command("pass", "rm", "-f", passEntry(name)).Run()
+}
+
+// list parses the tree-formatted output of `pass ls`, stripping the
+// box-drawing characters pass uses to render the directory tree.
+func (b *passBackend) list() ([]string, error) {
+	out, err := exec.Command("pass", "ls", keychainService).Output()
+	if err != nil {
+		return nil, fmt.Errorf("pass ls: %v", err)
+	}
+	var names []string
+	for _, line := range strings.Split(string(out), "\n") {
+		line = strings.TrimSpace(strings.Trim(line, " │├└─"))
+		if line == "" || line == keychainService || strings.HasPrefix(line, keychainService+" ") {
+			continue
+		}
+		names = append(names, line)
+	}
+	return names, nil
+}
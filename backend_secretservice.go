@@ -0,0 +1,54 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// secretServiceBackend stores secrets in the freedesktop.org Secret
+// Service (GNOME Keyring, KWallet, ...) via the "secret-tool"
+// command-line tool from libsecret.
+type secretServiceBackend struct{}
+
+func newSecretServiceBackend() *secretServiceBackend { return &secretServiceBackend{} }
+
+func (b *secretServiceBackend) get(name string) ([]byte, int, error) {
+	out, err := exec.Command("secret-tool", "lookup", "service", keychainService, "account", name).Output()
+	if err != nil {
+		return nil, 0, fmt.Errorf("secret-tool lookup %q: %v", name, err)
+	}
+	return decodeSecretValue(name, bytes.TrimRight(out, "\n"))
+}
+
+func (b *secretServiceBackend) add(name string, secret []byte, digits int) error {
+	cmd := exec.Command("secret-tool", "store",
+		"--label", keychainService+"/"+name, "service", keychainService, "account", name)
+	cmd.Stdin = bytes.NewReader(encodeSecretValue(secret, digits))
+	return cmd.Run()
+}
+
+func (b *secretServiceBackend) remove(name string) error {
+	return exec.Command("secret-tool", "clear", "service", keychainService, "account", name).Run()
+}
+
+func (b *secretServiceBackend) list() ([]string, error) {
+	out, err := exec.Command("secret-tool", "search", "--all", "service", keychainService).Output()
+	if err != nil {
+		return nil, fmt.Errorf("secret-tool search: %v", err)
+	}
+	var names []string
+	const prefix = "attribute.account = "
+	for _, line := range strings.Split(string(out), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, prefix) {
+			names = append(names, strings.TrimPrefix(line, prefix))
+		}
+	}
+	return names, nil
+}
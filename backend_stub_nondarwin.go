@@ -0,0 +1,11 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !darwin
+
+package main
+
+func newMacKeychainBackend() keychainBackend {
+	return unsupportedBackend{reason: "TWOFA_KEYRING=keychain is only supported on macOS"}
+}
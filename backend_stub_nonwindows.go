@@ -0,0 +1,11 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !windows
+
+package main
+
+func newWincredBackend() keychainBackend {
+	return unsupportedBackend{reason: "TWOFA_KEYRING=wincred is only supported on Windows"}
+}
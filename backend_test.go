@@ -0,0 +1,49 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import "fmt"
+
+// fakeBackend is an in-memory keychainBackend used to exercise
+// Keychain independent of any particular storage backend.
+type fakeBackend struct {
+	entries map[string][]byte // name -> "digits\nbase32secret"
+}
+
+func newFakeBackend() *fakeBackend {
+	return &fakeBackend{entries: make(map[string][]byte)}
+}
+
+func (b *fakeBackend) list() ([]string, error) {
+	var names []string
+	for name := range b.entries {
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+func (b *fakeBackend) get(name string) ([]byte, int, error) {
+	value, ok := b.entries[name]
+	if !ok {
+		return nil, 0, fmt.Errorf("no such key: %q", name)
+	}
+	return decodeSecretValue(name, value)
+}
+
+func (b *fakeBackend) add(name string, secret []byte, digits int) error {
+	if _, ok := b.entries[name]; ok {
+		return fmt.Errorf("key %q already exists", name)
+	}
+	b.entries[name] = encodeSecretValue(secret, digits)
+	return nil
+}
+
+func (b *fakeBackend) remove(name string) error {
+	if _, ok := b.entries[name]; !ok {
+		return fmt.Errorf("no such key: %q", name)
+	}
+	delete(b.entries, name)
+	return nil
+}
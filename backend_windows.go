@@ -0,0 +1,130 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	modadvapi32        = syscall.NewLazyDLL("advapi32.dll")
+	procCredWriteW     = modadvapi32.NewProc("CredWriteW")
+	procCredReadW      = modadvapi32.NewProc("CredReadW")
+	procCredDeleteW    = modadvapi32.NewProc("CredDeleteW")
+	procCredFree       = modadvapi32.NewProc("CredFree")
+	procCredEnumerateW = modadvapi32.NewProc("CredEnumerateW")
+)
+
+const (
+	credTypeGeneric         = 1
+	credPersistLocalMachine = 2
+)
+
+// credential mirrors the Win32 CREDENTIALW structure, trimmed to the
+// fields this backend uses.
+type credential struct {
+	Flags              uint32
+	Type               uint32
+	TargetName         *uint16
+	Comment            *uint16
+	LastWritten        syscall.Filetime
+	CredentialBlobSize uint32
+	CredentialBlob     *byte
+	Persist            uint32
+	AttributeCount     uint32
+	Attributes         uintptr
+	TargetAlias        *uint16
+	UserName           *uint16
+}
+
+// wincredBackend stores secrets in the Windows Credential Manager as
+// generic credentials named "rsc.io/2fa/NAME".
+type wincredBackend struct{}
+
+func newWincredBackend() *wincredBackend { return &wincredBackend{} }
+
+func credTarget(name string) string {
+	return keychainService + "/" + name
+}
+
+func (b *wincredBackend) add(name string, secret []byte, digits int) error {
+	value := encodeSecretValue(secret, digits)
+	target, err := syscall.UTF16PtrFromString(credTarget(name))
+	if err != nil {
+		return err
+	}
+	cred := credential{
+		Type:               credTypeGeneric,
+		TargetName:         target,
+		CredentialBlobSize: uint32(len(value)),
+		CredentialBlob:     &value[0],
+		Persist:            credPersistLocalMachine,
+	}
+	r, _, err := procCredWriteW.Call(uintptr(unsafe.Pointer(&cred)), 0)
+	if r == 0 {
+		return fmt.Errorf("CredWrite %q: %v", name, err)
+	}
+	return nil
+}
+
+func (b *wincredBackend) get(name string) ([]byte, int, error) {
+	target, err := syscall.UTF16PtrFromString(credTarget(name))
+	if err != nil {
+		return nil, 0, err
+	}
+	var pcred *credential
+	r, _, err := procCredReadW.Call(uintptr(unsafe.Pointer(target)), credTypeGeneric, 0, uintptr(unsafe.Pointer(&pcred)))
+	if r == 0 {
+		return nil, 0, fmt.Errorf("CredRead %q: %v", name, err)
+	}
+	defer procCredFree.Call(uintptr(unsafe.Pointer(pcred)))
+
+	value := make([]byte, pcred.CredentialBlobSize)
+	copy(value, unsafe.Slice(pcred.CredentialBlob, pcred.CredentialBlobSize))
+	return decodeSecretValue(name, value)
+}
+
+func (b *wincredBackend) remove(name string) error {
+	target, err := syscall.UTF16PtrFromString(credTarget(name))
+	if err != nil {
+		return err
+	}
+	r, _, err := procCredDeleteW.Call(uintptr(unsafe.Pointer(target)), credTypeGeneric, 0)
+	if r == 0 {
+		return fmt.Errorf("CredDelete %q: %v", name, err)
+	}
+	return nil
+}
+
+func (b *wincredBackend) list() ([]string, error) {
+	filter, err := syscall.UTF16PtrFromString(keychainService + "/*")
+	if err != nil {
+		return nil, err
+	}
+	var count uint32
+	var pcreds uintptr
+	r, _, err := procCredEnumerateW.Call(uintptr(unsafe.Pointer(filter)), 0,
+		uintptr(unsafe.Pointer(&count)), uintptr(unsafe.Pointer(&pcreds)))
+	if r == 0 {
+		return nil, fmt.Errorf("CredEnumerate: %v", err)
+	}
+	defer procCredFree.Call(pcreds)
+
+	prefix := keychainService + "/"
+	creds := unsafe.Slice((**credential)(unsafe.Pointer(pcreds)), count)
+	var names []string
+	for _, c := range creds {
+		target := syscall.UTF16ToString((*[1 << 20]uint16)(unsafe.Pointer(c.TargetName))[:])
+		if strings.HasPrefix(target, prefix) {
+			names = append(names, strings.TrimPrefix(target, prefix))
+		}
+	}
+	return names, nil
+}
@@ -0,0 +1,228 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// resyncWindow is how many counter values forward -resync searches
+// for a code matching an HOTP key, mirroring the window most
+// server-side HOTP validators allow.
+const resyncWindow = 100
+
+// fileKeychainBackend is the default keychainBackend: the on-disk
+// plaintext or encrypted keystore file used by 2fa since its first
+// release.
+type fileKeychainBackend struct {
+	file       string
+	keys       map[string]Key
+	encrypted  bool
+	passphrase []byte // cached after unlocking, reused to re-encrypt on add/remove/passwd
+}
+
+// newFileKeychainBackend reads file (and its ".keystore" sibling, if
+// any) from disk and returns the backend for it, prompting for a
+// passphrase if the contents are an encrypted keystore.
+func newFileKeychainBackend(file string) *fileKeychainBackend {
+	data, err := ioutil.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		log.Fatal(err)
+	}
+	if ks, err := ioutil.ReadFile(file + ".keystore"); err == nil {
+		file += ".keystore"
+		data = ks
+	}
+	return newFileKeychainBackendFromData(file, data)
+}
+
+// newFileKeychainBackendFromData builds a fileKeychainBackend from
+// already-read file contents, without touching disk again. This is
+// what newKeychain uses so that tests can supply in-memory keychain
+// data directly.
+func newFileKeychainBackendFromData(file string, data []byte) *fileKeychainBackend {
+	b := &fileKeychainBackend{file: file, keys: make(map[string]Key)}
+	if isKeystore(data) {
+		b.encrypted = true
+		passphrase, err := readPassphrase("2fa: enter passphrase: ")
+		if err != nil {
+			log.Fatal(err)
+		}
+		keys, err := parseKeystore(data, passphrase)
+		if err != nil {
+			log.Fatal(err)
+		}
+		b.passphrase = passphrase
+		for name, k := range keys {
+			b.keys[name] = *k
+		}
+		return b
+	}
+	for name, k := range parseKeychainKeys(data) {
+		b.keys[name] = *k
+	}
+	return b
+}
+
+func (b *fileKeychainBackend) list() ([]string, error) {
+	var names []string
+	for name := range b.keys {
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+func (b *fileKeychainBackend) get(name string) ([]byte, int, error) {
+	k, ok := b.keys[name]
+	if !ok {
+		return nil, 0, fmt.Errorf("no such key: %q", name)
+	}
+	return k.key, k.digits, nil
+}
+
+func (b *fileKeychainBackend) add(name string, secret []byte, digits int) error {
+	return b.addKey(name, Key{digits: digits, key: secret})
+}
+
+// addKey is like add, but accepts a full Key so that entries carrying
+// a period, algorithm, or issuer (as parsed from an otpauth:// URI)
+// round-trip through the keychain file.
+func (b *fileKeychainBackend) addKey(name string, k Key) error {
+	if _, ok := b.keys[name]; ok {
+		return fmt.Errorf("key %q already exists", name)
+	}
+	b.keys[name] = k
+
+	if b.encrypted {
+		return b.rewriteKeystore()
+	}
+	f, err := os.OpenFile(b.file, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = fmt.Fprintln(f, formatKeychainLine(name, k))
+	return err
+}
+
+func (b *fileKeychainBackend) remove(name string) error {
+	if _, ok := b.keys[name]; !ok {
+		return fmt.Errorf("no such key: %q", name)
+	}
+	delete(b.keys, name)
+	return b.rewrite()
+}
+
+// code returns the current one-time code for name. For a TOTP key it
+// just evaluates totpFn against the current time; for an HOTP key it
+// evaluates hotpFn against the stored counter, then advances and
+// persists the counter so the next call produces a different code.
+func (b *fileKeychainBackend) code(name string, hotpFn func([]byte, uint64, int) int, totpFn func([]byte, time.Time, int) int) string {
+	k, ok := b.keys[name]
+	if !ok {
+		log.Fatalf("2fa: no such key: %q", name)
+	}
+	if !k.hotp {
+		return fmt.Sprintf("%0*d", k.digits, totpFn(decodeKey(k.key), time.Now(), k.digits))
+	}
+
+	code := hotpFn(decodeKey(k.key), k.counter, k.digits)
+	k.counter++
+	b.keys[name] = k
+	if err := b.rewrite(); err != nil {
+		log.Fatal(err)
+	}
+	return fmt.Sprintf("%0*d", k.digits, code)
+}
+
+// resync searches forward up to resyncWindow counter values from
+// name's stored counter for one that makes hotpFn produce
+// observedCode, then fast-forwards the stored counter to just past
+// the match, the same recovery a server-side HOTP validator performs
+// when a token has drifted out of sync.
+func (b *fileKeychainBackend) resync(name, observedCode string, hotpFn func([]byte, uint64, int) int) error {
+	k, ok := b.keys[name]
+	if !ok {
+		return fmt.Errorf("no such key: %q", name)
+	}
+	if !k.hotp {
+		return fmt.Errorf("key %q is not an HOTP key", name)
+	}
+
+	secret := decodeKey(k.key)
+	for i := uint64(0); i < resyncWindow; i++ {
+		counter := k.counter + i
+		code := fmt.Sprintf("%0*d", k.digits, hotpFn(secret, counter, k.digits))
+		if code == observedCode {
+			k.counter = counter + 1
+			b.keys[name] = k
+			return b.rewrite()
+		}
+	}
+	return fmt.Errorf("no code for %q matched in the next %d counter values", name, resyncWindow)
+}
+
+// setPassphrase re-encrypts the backend's contents under a new
+// passphrase, marking it as encrypted if it wasn't already.
+func (b *fileKeychainBackend) setPassphrase(passphrase []byte) error {
+	b.encrypted = true
+	b.passphrase = passphrase
+	return b.rewriteKeystore()
+}
+
+// rewrite persists b.keys to disk in whichever of the two on-disk
+// formats the backend is currently using.
+func (b *fileKeychainBackend) rewrite() error {
+	if b.encrypted {
+		return b.rewriteKeystore()
+	}
+	return b.rewritePlaintext()
+}
+
+func (b *fileKeychainBackend) rewriteKeystore() error {
+	data, err := marshalKeystore(b.keys, b.passphrase)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(b.file, data, 0600)
+}
+
+func (b *fileKeychainBackend) rewritePlaintext() error {
+	var buf bytes.Buffer
+	for name, k := range b.keys {
+		fmt.Fprintln(&buf, formatKeychainLine(name, k))
+	}
+	return writeFileAtomic(b.file, buf.Bytes(), 0600)
+}
+
+// writeFileAtomic writes data to a temp file in the same directory as
+// file, then renames it into place, so a crash or power loss mid-write
+// can never leave file truncated or half-written.
+func writeFileAtomic(file string, data []byte, perm os.FileMode) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(file), filepath.Base(file)+".tmp")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName)
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpName, perm); err != nil {
+		return err
+	}
+	return os.Rename(tmpName, file)
+}
@@ -0,0 +1,186 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Cost parameters for the scrypt key-derivation function used to turn
+// a passphrase into a key-encryption key (KEK). These match the
+// parameters used by the Ethereum keystore format that this layout is
+// modeled on. They are vars rather than consts so tests can lower
+// scryptN to keep scrypt's deliberately expensive cost from dominating
+// the test suite's running time.
+var (
+	scryptN     = 1 << 18
+	scryptR     = 8
+	scryptP     = 1
+	scryptDKLen = 32
+)
+
+// cryptoParams records everything needed to reverse the encryption of
+// a single keystore entry's secret, other than the passphrase itself.
+type cryptoParams struct {
+	Cipher     string `json:"cipher"`
+	CipherText []byte `json:"ciphertext"`
+	IV         []byte `json:"iv"`
+	KDF        string `json:"kdf"`
+	Salt       []byte `json:"salt"`
+	N          int    `json:"n"`
+	R          int    `json:"r"`
+	P          int    `json:"p"`
+	DKLen      int    `json:"dklen"`
+	MAC        []byte `json:"mac"`
+}
+
+// keystoreEntry is the on-disk, encrypted form of one keychain entry.
+// Period, Algorithm, Issuer, and Counter are omitted entirely for
+// entries that don't carry them, matching the plaintext keychain's
+// tagged form.
+type keystoreEntry struct {
+	Digits    int          `json:"digits"`
+	Period    int          `json:"period,omitempty"`
+	Algorithm string       `json:"algorithm,omitempty"`
+	Issuer    string       `json:"issuer,omitempty"`
+	Hotp      bool         `json:"hotp,omitempty"`
+	Counter   uint64       `json:"counter,omitempty"`
+	Crypto    cryptoParams `json:"crypto"`
+}
+
+// isKeystore reports whether data looks like a JSON keystore file
+// rather than the legacy plaintext "name digits base32key" format.
+func isKeystore(data []byte) bool {
+	data = bytes.TrimSpace(data)
+	return len(data) > 0 && data[0] == '{'
+}
+
+// deriveKEK derives the key-encryption key for passphrase and salt
+// using the keystore's fixed scrypt cost parameters.
+func deriveKEK(passphrase, salt []byte) ([]byte, error) {
+	return scryptKey(passphrase, salt, scryptN, scryptR, scryptP, scryptDKLen)
+}
+
+// encryptKeystoreEntry encrypts k's secret under passphrase, producing
+// a keystoreEntry that can be written to disk.
+func encryptKeystoreEntry(passphrase []byte, k Key) (*keystoreEntry, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	kek, err := deriveKEK(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(kek[:16])
+	if err != nil {
+		return nil, err
+	}
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(iv); err != nil {
+		return nil, err
+	}
+	cipherText := make([]byte, len(k.key))
+	cipher.NewCTR(block, iv).XORKeyStream(cipherText, k.key)
+
+	return &keystoreEntry{
+		Digits:    k.digits,
+		Period:    k.period,
+		Algorithm: k.algorithm,
+		Issuer:    k.issuer,
+		Hotp:      k.hotp,
+		Counter:   k.counter,
+		Crypto: cryptoParams{
+			Cipher:     "aes-128-ctr",
+			CipherText: cipherText,
+			IV:         iv,
+			KDF:        "scrypt",
+			Salt:       salt,
+			N:          scryptN,
+			R:          scryptR,
+			P:          scryptP,
+			DKLen:      scryptDKLen,
+			MAC:        keystoreMAC(kek, cipherText),
+		},
+	}, nil
+}
+
+// keystoreMAC computes the MAC that detects a wrong passphrase: a
+// SHA-256 digest of the second half of the derived key concatenated
+// with the ciphertext.
+func keystoreMAC(kek, cipherText []byte) []byte {
+	h := sha256.New()
+	h.Write(kek[16:32])
+	h.Write(cipherText)
+	return h.Sum(nil)
+}
+
+// decryptKeystoreEntry recovers the plaintext secret from e using
+// passphrase, returning an error if the passphrase is wrong.
+func decryptKeystoreEntry(passphrase []byte, e *keystoreEntry) ([]byte, error) {
+	kek, err := scryptKey(passphrase, e.Crypto.Salt, e.Crypto.N, e.Crypto.R, e.Crypto.P, e.Crypto.DKLen)
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal(keystoreMAC(kek, e.Crypto.CipherText), e.Crypto.MAC) {
+		return nil, errors.New("incorrect passphrase")
+	}
+	block, err := aes.NewCipher(kek[:16])
+	if err != nil {
+		return nil, err
+	}
+	secret := make([]byte, len(e.Crypto.CipherText))
+	cipher.NewCTR(block, e.Crypto.IV).XORKeyStream(secret, e.Crypto.CipherText)
+	return secret, nil
+}
+
+// parseKeystore decrypts every entry in the JSON keystore data using
+// passphrase, returning the same map shape as parseKeychainKeys.
+func parseKeystore(data []byte, passphrase []byte) (map[string]*Key, error) {
+	var entries map[string]keystoreEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("parsing keystore: %v", err)
+	}
+	keys := make(map[string]*Key)
+	for name, entry := range entries {
+		entry := entry
+		secret, err := decryptKeystoreEntry(passphrase, &entry)
+		if err != nil {
+			return nil, fmt.Errorf("decrypting key %q: %v", name, err)
+		}
+		keys[name] = &Key{
+			digits:    entry.Digits,
+			key:       secret,
+			period:    entry.Period,
+			algorithm: entry.Algorithm,
+			issuer:    entry.Issuer,
+			hotp:      entry.Hotp,
+			counter:   entry.Counter,
+		}
+	}
+	return keys, nil
+}
+
+// marshalKeystore re-encrypts every key in keys under passphrase and
+// returns the resulting keystore file contents.
+func marshalKeystore(keys map[string]Key, passphrase []byte) ([]byte, error) {
+	entries := make(map[string]keystoreEntry, len(keys))
+	for name, k := range keys {
+		entry, err := encryptKeystoreEntry(passphrase, k)
+		if err != nil {
+			return nil, err
+		}
+		entries[name] = *entry
+	}
+	return json.MarshalIndent(entries, "", "\t")
+}
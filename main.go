@@ -0,0 +1,653 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+/*
+Command 2fa implements two-factor authentication.
+
+Usage:
+
+	2fa -add [-7] [-8] [-hotp] [-encrypt] keyname
+	2fa -list
+	2fa -remove keyname
+	2fa -passwd
+	2fa -export keyname
+	2fa -import keyname digits
+	2fa -uri keyname
+	2fa -qr keyname
+	2fa -add-uri
+	2fa -resync keyname code
+	2fa keyname
+
+2fa generates single-use authentication codes, usually used as a
+second authentication factor in addition to a password, following
+RFC 4226 (HOTP) and RFC 6238 (TOTP).
+
+The -add command adds a new key to the 2fa keychain. It prompts
+for the key to add, as a base32 key, on standard input. Keys may
+be case-insensitive and padding is not required.
+
+The -7 and -8 options generate 7- and 8-digit codes, respectively.
+The default is 6 digits.
+
+The -hotp option marks the key as an HOTP key, using a counter
+instead of the time of day as the input to the one-time-password
+algorithm. The counter starts at 0 and is persisted back to the
+keychain each time the key's code is generated.
+
+The -encrypt option stores the new key in an encrypted keystore
+instead of the plaintext keychain file, prompting for a passphrase
+on /dev/tty. Once a keychain is encrypted, every subsequent -add
+reuses that passphrase to re-encrypt the keystore.
+
+The -list command lists the names of all the keys in the keychain.
+
+The -remove command deletes a key from the keychain.
+
+The -passwd command changes the passphrase on an encrypted keychain,
+re-encrypting every key under the new passphrase.
+
+The -export command prints an existing key's secret as a BIP39-style
+mnemonic phrase, suitable for writing down on paper as a backup.
+
+The -import command reads a mnemonic phrase (as produced by -export)
+from standard input and adds it to the keychain under the given name
+and digit count.
+
+The -uri command prints an existing key's otpauth:// URI, as used by
+most authenticator apps for QR-code-based setup.
+
+The -qr command renders that same otpauth:// URI as a QR code in the
+terminal, using the external qrencode tool.
+
+The -add-uri command reads an otpauth:// URI (as produced by -uri, or
+pasted from an authenticator app's "show QR code as text" option) from
+standard input and adds it to the keychain.
+
+The -resync command searches forward from an HOTP key's stored
+counter for a counter value that produces the given code, up to 100
+values ahead, and fast-forwards the stored counter to match. It is
+useful after the key has been used somewhere 2fa didn't see, such as
+directly against the server.
+
+Giving 2fa a key name on the command line prints the current
+authentication code for that key.
+*/
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: 2fa -add [-7] [-8] [-hotp] [-encrypt] keyname\n")
+	fmt.Fprintf(os.Stderr, "       2fa -list\n")
+	fmt.Fprintf(os.Stderr, "       2fa -remove keyname\n")
+	fmt.Fprintf(os.Stderr, "       2fa -passwd\n")
+	fmt.Fprintf(os.Stderr, "       2fa -export keyname\n")
+	fmt.Fprintf(os.Stderr, "       2fa -import keyname digits\n")
+	fmt.Fprintf(os.Stderr, "       2fa -uri keyname\n")
+	fmt.Fprintf(os.Stderr, "       2fa -qr keyname\n")
+	fmt.Fprintf(os.Stderr, "       2fa -add-uri\n")
+	fmt.Fprintf(os.Stderr, "       2fa -resync keyname code\n")
+	fmt.Fprintf(os.Stderr, "       2fa keyname\n")
+	os.Exit(2)
+}
+
+var (
+	flagAdd     = flag.Bool("add", false, "add a key")
+	flag7       = flag.Bool("7", false, "generate 7-digit code")
+	flag8       = flag.Bool("8", false, "generate 8-digit code")
+	flagHotp    = flag.Bool("hotp", false, "add key as HOTP (counter-based) key")
+	flagEncrypt = flag.Bool("encrypt", false, "store the new key in an encrypted keystore")
+	flagList    = flag.Bool("list", false, "list keys")
+	flagRemove  = flag.Bool("remove", false, "remove a key")
+	flagPasswd  = flag.Bool("passwd", false, "change the keychain passphrase")
+	flagExport  = flag.Bool("export", false, "export a key as a mnemonic phrase")
+	flagImport  = flag.Bool("import", false, "import a key from a mnemonic phrase")
+	flagURI     = flag.Bool("uri", false, "print a key's otpauth:// URI")
+	flagQR      = flag.Bool("qr", false, "render a key's otpauth:// URI as a QR code")
+	flagAddURI  = flag.Bool("add-uri", false, "add a key from an otpauth:// URI")
+	flagResync  = flag.Bool("resync", false, "resync an HOTP key's counter against an observed code")
+	flag2fa     = flag.String("2fa", filepath.Join(os.Getenv("HOME"), ".2fa"), "2fa file to use")
+)
+
+func main() {
+	log.SetPrefix("2fa: ")
+	log.SetFlags(0)
+	flag.Usage = usage
+	flag.Parse()
+
+	if *flagAdd {
+		if flag.NArg() != 1 {
+			usage()
+		}
+		add(flag.Arg(0))
+		return
+	}
+	if *flagList {
+		if flag.NArg() != 0 {
+			usage()
+		}
+		list()
+		return
+	}
+	if *flagRemove {
+		if flag.NArg() != 1 {
+			usage()
+		}
+		remove(flag.Arg(0))
+		return
+	}
+	if *flagPasswd {
+		if flag.NArg() != 0 {
+			usage()
+		}
+		passwd()
+		return
+	}
+	if *flagExport {
+		if flag.NArg() != 1 {
+			usage()
+		}
+		export(flag.Arg(0))
+		return
+	}
+	if *flagImport {
+		if flag.NArg() != 2 {
+			usage()
+		}
+		digits, err := strconv.Atoi(flag.Arg(1))
+		if err != nil {
+			log.Fatalf("invalid digits: %v", err)
+		}
+		importKey(flag.Arg(0), digits)
+		return
+	}
+	if *flagURI {
+		if flag.NArg() != 1 {
+			usage()
+		}
+		printURI(flag.Arg(0))
+		return
+	}
+	if *flagQR {
+		if flag.NArg() != 1 {
+			usage()
+		}
+		printQR(flag.Arg(0))
+		return
+	}
+	if *flagAddURI {
+		if flag.NArg() != 0 {
+			usage()
+		}
+		addURI()
+		return
+	}
+	if *flagResync {
+		if flag.NArg() != 2 {
+			usage()
+		}
+		resync(flag.Arg(0), flag.Arg(1))
+		return
+	}
+	if flag.NArg() != 1 {
+		usage()
+	}
+	show(flag.Arg(0))
+}
+
+// A Key holds the parsed state of one keychain entry. period,
+// algorithm, and issuer are carried through from an otpauth:// URI so
+// that -uri and -export can round-trip them; code generation still
+// always uses a 30-second SHA1 TOTP, regardless of their values. hotp
+// and counter do affect code generation: an hotp key's code is an
+// HMAC-based one-time password over the stored counter, which
+// advances by one on every use.
+type Key struct {
+	digits    int
+	key       []byte // base32-encoded secret
+	period    int    // seconds; 0 means the otpauth default of 30
+	algorithm string // "" means the otpauth default of SHA1
+	issuer    string // "" means no issuer
+	hotp      bool   // counter-based instead of time-based
+	counter   uint64 // next counter value to use, valid only when hotp
+}
+
+// A Keychain holds a set of named keys, backed by a keychainBackend,
+// along with the functions used to compute one-time codes, which are
+// replaced by fakes in tests.
+type Keychain struct {
+	backend keychainBackend
+	Hotp    func(key []byte, counter uint64, digits int) int
+	Totp    func(key []byte, t time.Time, digits int) int
+}
+
+// readKeychain opens the keychain backend selected by the
+// TWOFA_KEYRING environment variable, defaulting to the file at file.
+func readKeychain(file string) *Keychain {
+	return &Keychain{
+		backend: openBackend(file),
+		Hotp:    hotp,
+		Totp:    totp,
+	}
+}
+
+// newKeychain builds a Keychain directly from in-memory keychain file
+// contents, bypassing TWOFA_KEYRING and disk I/O. It exists so tests
+// can exercise the file-backed format without touching the real
+// filesystem or environment.
+func newKeychain(file string, data []byte) *Keychain {
+	return &Keychain{
+		backend: newFileKeychainBackendFromData(file, data),
+		Hotp:    hotp,
+		Totp:    totp,
+	}
+}
+
+// parseKeychainKeyLine splits a single keychain line into its
+// whitespace-separated fields, ignoring any amount of surrounding
+// or trailing whitespace (including blank lines).
+func parseKeychainKeyLine(line []byte) [][]byte {
+	return bytes.Fields(line)
+}
+
+// parseKeychainKeys parses the on-disk keychain format, one entry per
+// line. Each line is one of:
+//   - the legacy 3-field TOTP form, "name digits base32key"
+//   - the explicit 4-field TOTP form, "name totp digits base32key"
+//   - the 5-field HOTP form, "name hotp digits counter base32key"
+//   - a tagged form, "name digits=N secret=base32key [type=hotp]
+//     [counter=N] [period=N] [algorithm=NAME] [issuer=NAME]", used
+//     when an entry carries otpauth parameters that don't fit the
+//     other forms
+func parseKeychainKeys(data []byte) map[string]*Key {
+	keys := make(map[string]*Key)
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		fields := parseKeychainKeyLine(line)
+		if len(fields) == 0 {
+			continue
+		}
+		name := string(fields[0])
+		k, err := parseKeychainKeyFields(name, fields[1:])
+		if err != nil {
+			log.Printf("invalid keychain entry: %q: %v", line, err)
+			continue
+		}
+		keys[name] = k
+	}
+	return keys
+}
+
+// parseKeychainKeyFields parses the fields of a keychain line after
+// the name: the legacy [digits, base32key] pair, an explicit
+// ["totp"|"hotp", ...] form, or a list of key=value tags.
+func parseKeychainKeyFields(name string, fields [][]byte) (*Key, error) {
+	if len(fields) == 2 && !bytes.ContainsRune(fields[0], '=') {
+		digits, err := strconv.Atoi(string(fields[0]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid digits for key %q: %v", name, err)
+		}
+		return &Key{digits: digits, key: fields[1]}, nil
+	}
+
+	if len(fields) > 0 {
+		switch string(fields[0]) {
+		case "totp":
+			if len(fields) != 3 {
+				return nil, fmt.Errorf("malformed totp entry for key %q", name)
+			}
+			digits, err := strconv.Atoi(string(fields[1]))
+			if err != nil {
+				return nil, fmt.Errorf("invalid digits for key %q: %v", name, err)
+			}
+			return &Key{digits: digits, key: fields[2]}, nil
+		case "hotp":
+			if len(fields) != 4 {
+				return nil, fmt.Errorf("malformed hotp entry for key %q", name)
+			}
+			digits, err := strconv.Atoi(string(fields[1]))
+			if err != nil {
+				return nil, fmt.Errorf("invalid digits for key %q: %v", name, err)
+			}
+			counter, err := strconv.ParseUint(string(fields[2]), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid counter for key %q: %v", name, err)
+			}
+			return &Key{digits: digits, key: fields[3], hotp: true, counter: counter}, nil
+		}
+	}
+
+	var k Key
+	haveDigits, haveKey := false, false
+	for _, field := range fields {
+		tag := bytes.SplitN(field, []byte("="), 2)
+		if len(tag) != 2 {
+			return nil, fmt.Errorf("malformed field %q", field)
+		}
+		val := tag[1]
+		switch string(tag[0]) {
+		case "digits":
+			digits, err := strconv.Atoi(string(val))
+			if err != nil {
+				return nil, fmt.Errorf("invalid digits: %v", err)
+			}
+			k.digits, haveDigits = digits, true
+		case "secret":
+			k.key, haveKey = val, true
+		case "period":
+			period, err := strconv.Atoi(string(val))
+			if err != nil {
+				return nil, fmt.Errorf("invalid period: %v", err)
+			}
+			k.period = period
+		case "algorithm":
+			k.algorithm = string(val)
+		case "issuer":
+			k.issuer = string(val)
+		case "type":
+			k.hotp = string(val) == "hotp"
+		case "counter":
+			counter, err := strconv.ParseUint(string(val), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid counter: %v", err)
+			}
+			k.counter = counter
+		}
+	}
+	if !haveDigits || !haveKey {
+		return nil, errors.New("missing digits or secret")
+	}
+	return &k, nil
+}
+
+// formatKeychainLine renders name and k back into the on-disk
+// keychain format: the legacy 3-field form for a plain TOTP key, the
+// 5-field hotp form for an HOTP key with no extra otpauth parameters,
+// or the tagged form otherwise.
+func formatKeychainLine(name string, k Key) string {
+	plain := k.period == 0 && k.algorithm == "" && k.issuer == ""
+	switch {
+	case k.hotp && plain:
+		return fmt.Sprintf("%s hotp %d %d %s", name, k.digits, k.counter, k.key)
+	case plain:
+		return fmt.Sprintf("%s %d %s", name, k.digits, k.key)
+	}
+
+	line := fmt.Sprintf("%s digits=%d secret=%s", name, k.digits, k.key)
+	if k.hotp {
+		line += fmt.Sprintf(" type=hotp counter=%d", k.counter)
+	}
+	if k.period != 0 {
+		line += fmt.Sprintf(" period=%d", k.period)
+	}
+	if k.algorithm != "" {
+		line += " algorithm=" + k.algorithm
+	}
+	if k.issuer != "" {
+		line += " issuer=" + k.issuer
+	}
+	return line
+}
+
+func decodeKey(key []byte) []byte {
+	k := strings.ToUpper(strings.TrimSpace(string(key)))
+	k = strings.TrimRight(k, "=")
+	raw, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(k)
+	if err != nil {
+		log.Fatalf("invalid key: %v", err)
+	}
+	return raw
+}
+
+// code returns the current one-time code for the named key. For an
+// HOTP key stored in the file backend, it also advances and persists
+// the key's counter; other backends don't carry the hotp flag or
+// counter, so their keys are always treated as TOTP.
+func (c *Keychain) code(name string) string {
+	if fb, ok := c.backend.(*fileKeychainBackend); ok {
+		return fb.code(name, c.Hotp, c.Totp)
+	}
+	secret, digits, err := c.backend.get(name)
+	if err != nil {
+		log.Fatal(err)
+	}
+	code := c.Totp(decodeKey(secret), time.Now(), digits)
+	return fmt.Sprintf("%0*d", digits, code)
+}
+
+func (c *Keychain) list() []string {
+	names, err := c.backend.list()
+	if err != nil {
+		log.Fatal(err)
+	}
+	return names
+}
+
+func (c *Keychain) add(name string, digits int, key []byte) {
+	if err := c.backend.add(name, key, digits); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func (c *Keychain) remove(name string) {
+	if err := c.backend.remove(name); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// lookupFull returns the full Key for name, including its period,
+// algorithm, and issuer when the backend is able to carry them. Only
+// the file backend stores those extra fields today; other backends
+// report just digits and secret, so the result's period, algorithm,
+// and issuer are left at their zero values.
+func (c *Keychain) lookupFull(name string) Key {
+	if fb, ok := c.backend.(*fileKeychainBackend); ok {
+		k, ok := fb.keys[name]
+		if !ok {
+			log.Fatalf("2fa: no such key: %q", name)
+		}
+		return k
+	}
+	secret, digits, err := c.backend.get(name)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return Key{digits: digits, key: secret}
+}
+
+// addFull adds k under name, preserving its period, algorithm, and
+// issuer when the backend can store them. Other backends reject a key
+// that carries any of those fields, since they would otherwise be
+// silently dropped.
+func (c *Keychain) addFull(name string, k Key) {
+	if fb, ok := c.backend.(*fileKeychainBackend); ok {
+		if err := fb.addKey(name, k); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if k.period != 0 || k.algorithm != "" || k.issuer != "" || k.hotp {
+		log.Fatal("2fa: a key with a custom period, algorithm, issuer, or HOTP counter requires the file backend")
+	}
+	c.add(name, k.digits, k.key)
+}
+
+func add(name string) {
+	digits := 6
+	switch {
+	case *flag7:
+		digits = 7
+	case *flag8:
+		digits = 8
+	}
+	fmt.Fprintf(os.Stderr, "2fa: enter key: ")
+	key, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		log.Fatal(err)
+	}
+	key = strings.TrimSpace(key)
+	if _, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.ToUpper(key)); err != nil {
+		log.Fatalf("invalid key: %v", err)
+	}
+
+	keychain := readKeychain(*flag2fa)
+	if *flagEncrypt {
+		fb, ok := keychain.backend.(*fileKeychainBackend)
+		if !ok {
+			log.Fatal("2fa: -encrypt only applies to the file backend")
+		}
+		if !fb.encrypted {
+			passphrase, err := readPassphrase("2fa: new passphrase: ")
+			if err != nil {
+				log.Fatal(err)
+			}
+			fb.encrypted = true
+			fb.passphrase = passphrase
+		}
+	}
+	if *flagHotp {
+		keychain.addFull(name, Key{digits: digits, key: []byte(key), hotp: true})
+		return
+	}
+	keychain.add(name, digits, []byte(key))
+}
+
+func passwd() {
+	keychain := readKeychain(*flag2fa)
+	fb, ok := keychain.backend.(*fileKeychainBackend)
+	if !ok {
+		log.Fatal("2fa: -passwd only applies to the file backend")
+	}
+	if !fb.encrypted {
+		log.Fatal("2fa: keychain is not encrypted; add a key with -encrypt first")
+	}
+	passphrase, err := readPassphrase("2fa: new passphrase: ")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := fb.setPassphrase(passphrase); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func list() {
+	keychain := readKeychain(*flag2fa)
+	names := keychain.list()
+	for _, name := range names {
+		fmt.Println(name)
+	}
+}
+
+func remove(name string) {
+	keychain := readKeychain(*flag2fa)
+	keychain.remove(name)
+}
+
+func show(name string) {
+	keychain := readKeychain(*flag2fa)
+	fmt.Println(keychain.code(name))
+}
+
+func export(name string) {
+	keychain := readKeychain(*flag2fa)
+	secret, _, err := keychain.backend.get(name)
+	if err != nil {
+		log.Fatal(err)
+	}
+	words, err := encodeMnemonic(decodeKey(secret))
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(strings.Join(words, " "))
+}
+
+func importKey(name string, digits int) {
+	fmt.Fprintf(os.Stderr, "2fa: enter mnemonic: ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		log.Fatal(err)
+	}
+	secret, err := decodeMnemonic(strings.Fields(line))
+	if err != nil {
+		log.Fatalf("invalid mnemonic: %v", err)
+	}
+	key := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(secret)
+
+	keychain := readKeychain(*flag2fa)
+	keychain.add(name, digits, []byte(key))
+}
+
+func printURI(name string) {
+	keychain := readKeychain(*flag2fa)
+	fmt.Println(otpauthURI(name, keychain.lookupFull(name)))
+}
+
+func printQR(name string) {
+	keychain := readKeychain(*flag2fa)
+	uri := otpauthURI(name, keychain.lookupFull(name))
+	cmd := exec.Command("qrencode", "-t", "ANSIUTF8", uri)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		log.Fatalf("2fa: rendering QR code (is qrencode installed?): %v", err)
+	}
+}
+
+func addURI() {
+	fmt.Fprintf(os.Stderr, "2fa: enter otpauth:// URI: ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		log.Fatal(err)
+	}
+	name, k, err := parseOtpauthURI(strings.TrimSpace(line))
+	if err != nil {
+		log.Fatalf("invalid otpauth URI: %v", err)
+	}
+
+	keychain := readKeychain(*flag2fa)
+	keychain.addFull(name, k)
+}
+
+func resync(name, observedCode string) {
+	keychain := readKeychain(*flag2fa)
+	fb, ok := keychain.backend.(*fileKeychainBackend)
+	if !ok {
+		log.Fatal("2fa: -resync only applies to the file backend")
+	}
+	if err := fb.resync(name, observedCode, keychain.Hotp); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func hotp(key []byte, counter uint64, digits int) int {
+	h := hmac.New(sha1.New, key)
+	binary.Write(h, binary.BigEndian, counter)
+	sum := h.Sum(nil)
+	v := binary.BigEndian.Uint32(sum[sum[len(sum)-1]&0x0f:]) & 0x7fffffff
+	d := uint32(1)
+	for i := 0; i < digits; i++ {
+		d *= 10
+	}
+	return int(v % d)
+}
+
+func totp(key []byte, t time.Time, digits int) int {
+	return hotp(key, uint64(t.Unix())/30, digits)
+}
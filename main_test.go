@@ -6,6 +6,7 @@ package main
 
 import (
 	"bytes"
+	"encoding/base32"
 	"fmt"
 	"io/ioutil"
 	"math/rand"
@@ -14,6 +15,15 @@ import (
 	"time"
 )
 
+// init lowers the scrypt cost parameters for the test binary. The
+// production values are deliberately expensive to slow down
+// brute-force passphrase guessing; paying that cost on every keystore
+// test run would make the suite unbearably slow without making the
+// tests any more meaningful.
+func init() {
+	scryptN = 1 << 10
+}
+
 func randBase32Bytes(n int) (b []byte) {
 	codeMap := []byte("abcdefghijklmnopqrstuvwxyz234567")
 	for i := 0; i < n; i++ {
@@ -151,6 +161,170 @@ func TestParseKeychainKeysTrailingNewlineAndSpaceCharacters(t *testing.T) {
 	}
 }
 
+func TestParseKeychainKeysTaggedForm(t *testing.T) {
+	githubKey := randBase32Bytes(16)
+	keychainBytes := []byte(fmt.Sprintf(
+		"github digits=6 secret=%s period=60 algorithm=SHA256 issuer=GitHub\n", githubKey))
+	keys := parseKeychainKeys(keychainBytes)
+	k, ok := keys["github"]
+	if !ok {
+		t.Fatal("key not found: github")
+	}
+	if k.digits != 6 {
+		t.Error("wrong digits count")
+	}
+	if !bytes.Equal(k.key, githubKey) {
+		t.Errorf("secret mismatch - Expected: %s, Actual: %s", githubKey, k.key)
+	}
+	if k.period != 60 {
+		t.Errorf("wrong period - Expected: 60, Actual: %d", k.period)
+	}
+	if k.algorithm != "SHA256" {
+		t.Errorf("wrong algorithm - Expected: SHA256, Actual: %s", k.algorithm)
+	}
+	if k.issuer != "GitHub" {
+		t.Errorf("wrong issuer - Expected: GitHub, Actual: %s", k.issuer)
+	}
+}
+
+func TestFormatKeychainLineRoundTrip(t *testing.T) {
+	githubKey := randBase32Bytes(16)
+	for _, k := range []Key{
+		{digits: 6, key: githubKey},
+		{digits: 7, key: githubKey, period: 60, algorithm: "SHA256", issuer: "GitHub"},
+	} {
+		line := formatKeychainLine("github", k)
+		got, err := parseKeychainKeyFields("github", parseKeychainKeyLine([]byte(line))[1:])
+		if err != nil {
+			t.Fatalf("parsing formatted line %q: %v", line, err)
+		}
+		if got.digits != k.digits || !bytes.Equal(got.key, k.key) ||
+			got.period != k.period || got.algorithm != k.algorithm || got.issuer != k.issuer {
+			t.Errorf("round trip mismatch - line: %q, Expected: %+v, Actual: %+v", line, k, *got)
+		}
+	}
+}
+
+func TestKeystoreRoundTrip(t *testing.T) {
+	githubKey := randBase32Bytes(16)
+	passphrase := []byte("correct horse battery staple")
+
+	keys := map[string]Key{
+		"github": {digits: 6, key: githubKey},
+	}
+	data, err := marshalKeystore(keys, passphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isKeystore(data) {
+		t.Fatal("marshaled keystore not recognized by isKeystore")
+	}
+
+	decoded, err := parseKeystore(data, passphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k, ok := decoded["github"]
+	if !ok {
+		t.Fatal("key not found after round trip:", "github")
+	}
+	if k.digits != 6 {
+		t.Error("wrong digits count after round trip")
+	}
+	if !bytes.Equal(k.key, githubKey) {
+		t.Errorf("secret mismatch after round trip - Expected: %s, Actual: %s", githubKey, k.key)
+	}
+}
+
+func TestKeystoreRoundTripHotp(t *testing.T) {
+	githubKey := randBase32Bytes(16)
+	passphrase := []byte("correct horse battery staple")
+
+	keys := map[string]Key{
+		"github": {digits: 6, key: githubKey, hotp: true, counter: 5},
+	}
+	data, err := marshalKeystore(keys, passphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := parseKeystore(data, passphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k, ok := decoded["github"]
+	if !ok {
+		t.Fatal("key not found after round trip:", "github")
+	}
+	if !k.hotp {
+		t.Error("wrong hotp flag after round trip - Expected: true, Actual: false")
+	}
+	if k.counter != 5 {
+		t.Errorf("wrong counter after round trip - Expected: 5, Actual: %d", k.counter)
+	}
+	if !bytes.Equal(k.key, githubKey) {
+		t.Errorf("secret mismatch after round trip - Expected: %s, Actual: %s", githubKey, k.key)
+	}
+}
+
+func TestKeystoreWrongPassphrase(t *testing.T) {
+	keys := map[string]Key{
+		"github": {digits: 6, key: randBase32Bytes(16)},
+	}
+	data, err := marshalKeystore(keys, []byte("the right passphrase"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parseKeystore(data, []byte("the wrong passphrase")); err == nil {
+		t.Error("parseKeystore succeeded with the wrong passphrase")
+	}
+}
+
+func TestMnemonicRoundTrip(t *testing.T) {
+	for i := 0; i < 5; i++ {
+		base32Key := randBase32Bytes(16)
+		secret := decodeKey(base32Key)
+
+		words, err := encodeMnemonic(secret)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := decodeMnemonic(words)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(decoded, secret) {
+			t.Fatalf("round trip mismatch - Expected: %x, Actual: %x", secret, decoded)
+		}
+
+		recoveredKey := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(decoded)
+		backend := newFakeBackend()
+		if err := backend.add("imported", []byte(recoveredKey), 6); err != nil {
+			t.Fatal(err)
+		}
+		keychain := &Keychain{backend: backend, Hotp: mockHotp, Totp: mockTotp}
+
+		wantCode := fmt.Sprintf("%06d", mockTotp(secret, time.Time{}, 6))
+		if got := keychain.code("imported"); got != wantCode {
+			t.Errorf("mnemonic round trip produced wrong code - Expected: %s, Actual: %s", wantCode, got)
+		}
+	}
+}
+
+func TestMnemonicChecksumMismatch(t *testing.T) {
+	words, err := encodeMnemonic(decodeKey(randBase32Bytes(16)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Swap the last word for a different one, corrupting the checksum.
+	last := mnemonicWordIndex[words[len(words)-1]]
+	words[len(words)-1] = mnemonicWords[(last+1)%len(mnemonicWords)]
+
+	if _, err := decodeMnemonic(words); err == nil {
+		t.Error("decodeMnemonic succeeded with a corrupted phrase")
+	}
+}
+
 func mockHotp(key []byte, counter uint64, digits int) int {
 	return hotp(key, 0, digits)
 }
@@ -159,19 +333,99 @@ func mockTotp(key []byte, t time.Time, digits int) int {
 	return hotp(key, 0, digits)
 }
 
+// testKeychainCodeTotp runs the TestKeychainCodeTotp assertions
+// against whatever backend is already populated with the github and
+// google entries used throughout this file, so the test works the
+// same way regardless of which keychainBackend is under test.
+func testKeychainCodeTotp(t *testing.T, backend keychainBackend) {
+	t.Helper()
+	keychain := &Keychain{backend: backend, Hotp: mockHotp, Totp: mockTotp}
+	for k, v := range map[string]string{"github": "149042", "google": "561295"} {
+		code := keychain.code(k)
+		if code != v {
+			t.Errorf("incorrect code - Key: %s, Expected %s, Actual %s", k, v, code)
+		}
+	}
+}
+
 func TestKeychainCodeTotp(t *testing.T) {
 	keychainBytes := []byte("github 6 abcdef23ghijkl45\ngoogle 6 mnopqr67stuvwx23")
 	file, err := temp2faFile(keychainBytes)
 	if err != nil {
 		t.Error(err)
 	}
-	keychain := newKeychain(file.Name(), keychainBytes)
-	keychain.Hotp = mockHotp
-	keychain.Totp = mockTotp
-	for k, v := range map[string]string{"github": "149042", "google": "561295"} {
-		code := keychain.code(k)
-		if code != v {
-			t.Errorf("incorrect code - Key: %s, Expected %s, Actual %s", k, v, code)
-		}
+	testKeychainCodeTotp(t, newFileKeychainBackendFromData(file.Name(), keychainBytes))
+}
+
+// TestKeychainCodeHotp is the HOTP counterpart to TestKeychainCodeTotp:
+// it checks that successive code() calls on an HOTP key advance
+// through the expected counter values and that the new counter is
+// persisted back to the keychain file in between calls.
+func TestKeychainCodeHotp(t *testing.T) {
+	key := randBase32Bytes(16)
+	secret := decodeKey(key)
+	keychainBytes := []byte(fmt.Sprintf("github hotp 6 0 %s\n", key))
+	file, err := temp2faFile(keychainBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend := newFileKeychainBackendFromData(file.Name(), keychainBytes)
+	keychain := &Keychain{backend: backend, Hotp: hotp, Totp: mockTotp}
+
+	wantFirst := fmt.Sprintf("%06d", hotp(secret, 0, 6))
+	if got := keychain.code("github"); got != wantFirst {
+		t.Errorf("first HOTP code - Expected: %s, Actual: %s", wantFirst, got)
+	}
+
+	data, err := ioutil.ReadFile(file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k, ok := parseKeychainKeys(data)["github"]; !ok || k.counter != 1 {
+		t.Fatalf("counter not persisted after first code() call - keys: %+v", parseKeychainKeys(data))
+	}
+
+	wantSecond := fmt.Sprintf("%06d", hotp(secret, 1, 6))
+	if got := keychain.code("github"); got != wantSecond {
+		t.Errorf("second HOTP code - Expected: %s, Actual: %s", wantSecond, got)
+	}
+
+	data, err = ioutil.ReadFile(file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	k, ok := parseKeychainKeys(data)["github"]
+	if !ok {
+		t.Fatal("key not found after second code(): github")
+	}
+	if k.counter != 2 {
+		t.Errorf("counter not persisted after second code() call - Expected: 2, Actual: %d", k.counter)
+	}
+	if !k.hotp {
+		t.Error("key lost its hotp flag after round trip")
+	}
+}
+
+func TestKeychainCodeTotpFakeBackend(t *testing.T) {
+	backend := newFakeBackend()
+	if err := backend.add("github", []byte("abcdef23ghijkl45"), 6); err != nil {
+		t.Fatal(err)
+	}
+	if err := backend.add("google", []byte("mnopqr67stuvwx23"), 6); err != nil {
+		t.Fatal(err)
+	}
+	testKeychainCodeTotp(t, backend)
+}
+
+func TestKeychainRemove(t *testing.T) {
+	backend := newFakeBackend()
+	if err := backend.add("github", []byte("abcdef23ghijkl45"), 6); err != nil {
+		t.Fatal(err)
+	}
+	keychain := &Keychain{backend: backend}
+
+	keychain.remove("github")
+	if _, _, err := backend.get("github"); err == nil {
+		t.Error("key still present after remove")
 	}
 }
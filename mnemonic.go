@@ -0,0 +1,138 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+)
+
+// encodeMnemonic converts secret's raw bytes into a BIP39-style
+// mnemonic phrase: a one-byte length prefix and secret, zero-padded
+// to a multiple of 4 bytes, followed by a checksum equal to the first
+// len(payload)*8/32 bits of SHA256(payload), packed into 11-bit
+// groups that each index mnemonicWords.
+func encodeMnemonic(secret []byte) ([]string, error) {
+	if len(secret) > 255 {
+		return nil, fmt.Errorf("secret is too long to encode as a mnemonic (%d bytes)", len(secret))
+	}
+
+	payload := append([]byte{byte(len(secret))}, secret...)
+	for len(payload)%4 != 0 {
+		payload = append(payload, 0)
+	}
+	checksumBits := len(payload) / 4
+	sum := sha256.Sum256(payload)
+
+	b := new(bitstream)
+	for _, p := range payload {
+		b.append(uint32(p), 8)
+	}
+	b.append(firstBits(sum[:], checksumBits), checksumBits)
+	b.pad(11)
+
+	words := make([]string, b.len()/11)
+	for i := range words {
+		words[i] = mnemonicWords[b.peek(i*11, 11)]
+	}
+	return words, nil
+}
+
+// decodeMnemonic reverses encodeMnemonic, returning an error if any
+// word is unrecognized or the checksum doesn't match (most likely a
+// mistyped word).
+func decodeMnemonic(words []string) ([]byte, error) {
+	b := new(bitstream)
+	for _, word := range words {
+		idx, ok := mnemonicWordIndex[word]
+		if !ok {
+			return nil, fmt.Errorf("not a mnemonic word: %q", word)
+		}
+		b.append(uint32(idx), 11)
+	}
+
+	if b.len() < 8 {
+		return nil, errors.New("mnemonic is too short")
+	}
+	secretLen := int(b.read(8))
+	payloadLen := secretLen + 1
+	for payloadLen%4 != 0 {
+		payloadLen++
+	}
+	checksumBits := payloadLen / 4
+	if b.len()-b.pos < (payloadLen-1)*8+checksumBits {
+		return nil, errors.New("mnemonic is too short for its encoded length")
+	}
+
+	rest := make([]byte, payloadLen-1)
+	for i := range rest {
+		rest[i] = byte(b.read(8))
+	}
+	payload := append([]byte{byte(secretLen)}, rest...)
+	gotChecksum := b.read(checksumBits)
+
+	sum := sha256.Sum256(payload)
+	if wantChecksum := firstBits(sum[:], checksumBits); gotChecksum != wantChecksum {
+		return nil, errors.New("mnemonic checksum does not match; check for a mistyped word")
+	}
+	return payload[1 : 1+secretLen], nil
+}
+
+// firstBits returns the first n bits of b (n <= 32), most significant
+// bit first, as the low n bits of a uint32.
+func firstBits(b []byte, n int) uint32 {
+	var v uint32
+	for i := 0; i < n; i++ {
+		v <<= 1
+		if b[i/8]&(1<<uint(7-i%8)) != 0 {
+			v |= 1
+		}
+	}
+	return v
+}
+
+// bitstream is an append-only sequence of bits, most significant bit
+// first, with a read cursor for decoding it back out in arbitrary-
+// width chunks.
+type bitstream struct {
+	bits []bool
+	pos  int
+}
+
+func (b *bitstream) len() int { return len(b.bits) }
+
+// append adds the low n bits of v, most significant first.
+func (b *bitstream) append(v uint32, n int) {
+	for i := n - 1; i >= 0; i-- {
+		b.bits = append(b.bits, v&(1<<uint(i)) != 0)
+	}
+}
+
+// pad appends zero bits until the stream's length is a multiple of n.
+func (b *bitstream) pad(n int) {
+	for len(b.bits)%n != 0 {
+		b.bits = append(b.bits, false)
+	}
+}
+
+// peek reads n bits starting at pos without advancing the read cursor.
+func (b *bitstream) peek(pos, n int) uint32 {
+	var v uint32
+	for i := 0; i < n; i++ {
+		v <<= 1
+		if b.bits[pos+i] {
+			v |= 1
+		}
+	}
+	return v
+}
+
+// read reads the next n bits from the read cursor, advancing it.
+func (b *bitstream) read(n int) uint32 {
+	v := b.peek(b.pos, n)
+	b.pos += n
+	return v
+}
@@ -0,0 +1,34 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	tiocgeta = 0x40487413
+	tiocseta = 0x80487414
+)
+
+// disableEcho turns off terminal echo on f, returning a function that
+// restores the previous state.
+func disableEcho(f *os.File) (func(), error) {
+	fd := f.Fd()
+	var oldState syscall.Termios
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, tiocgeta, uintptr(unsafe.Pointer(&oldState))); errno != 0 {
+		return nil, errno
+	}
+	newState := oldState
+	newState.Lflag &^= syscall.ECHO
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, tiocseta, uintptr(unsafe.Pointer(&newState))); errno != 0 {
+		return nil, errno
+	}
+	return func() {
+		syscall.Syscall(syscall.SYS_IOCTL, fd, tiocseta, uintptr(unsafe.Pointer(&oldState)))
+	}, nil
+}
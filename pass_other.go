@@ -0,0 +1,18 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !linux && !darwin
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// disableEcho is not implemented on this platform; readPassphrase
+// falls back to echoing the passphrase as it is typed.
+func disableEcho(f *os.File) (func(), error) {
+	return nil, errors.New("disabling terminal echo is not supported on this platform")
+}
@@ -0,0 +1,74 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestResync(t *testing.T) {
+	key := randBase32Bytes(16)
+	secret := decodeKey(key)
+	keychainBytes := []byte(fmt.Sprintf("github hotp 6 0 %s\n", key))
+	file, err := temp2faFile(keychainBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend := newFileKeychainBackendFromData(file.Name(), keychainBytes)
+
+	observed := fmt.Sprintf("%06d", hotp(secret, 5, 6))
+	if err := backend.resync("github", observed, hotp); err != nil {
+		t.Fatal(err)
+	}
+	k, ok := backend.keys["github"]
+	if !ok {
+		t.Fatal("key not found after resync: github")
+	}
+	if k.counter != 6 {
+		t.Errorf("counter not fast-forwarded - Expected: 6, Actual: %d", k.counter)
+	}
+}
+
+func TestResyncNoMatch(t *testing.T) {
+	key := randBase32Bytes(16)
+	secret := decodeKey(key)
+	keychainBytes := []byte(fmt.Sprintf("github hotp 6 0 %s\n", key))
+	file, err := temp2faFile(keychainBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend := newFileKeychainBackendFromData(file.Name(), keychainBytes)
+
+	seen := make(map[string]bool)
+	for i := uint64(0); i < resyncWindow; i++ {
+		seen[fmt.Sprintf("%06d", hotp(secret, i, 6))] = true
+	}
+	var observed string
+	for i := 0; i < 1000000; i++ {
+		observed = fmt.Sprintf("%06d", i)
+		if !seen[observed] {
+			break
+		}
+	}
+
+	if err := backend.resync("github", observed, hotp); err == nil {
+		t.Error("resync succeeded without a matching code in range")
+	}
+}
+
+func TestResyncRejectsTotpKey(t *testing.T) {
+	key := randBase32Bytes(16)
+	keychainBytes := []byte(fmt.Sprintf("github 6 %s\n", key))
+	file, err := temp2faFile(keychainBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend := newFileKeychainBackendFromData(file.Name(), keychainBytes)
+
+	if err := backend.resync("github", "000000", hotp); err == nil {
+		t.Error("resync succeeded on a TOTP key")
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// otpauthURI builds the otpauth://totp/ or otpauth://hotp/ URI for
+// name and k, in the form produced by most authenticator apps'
+// "export" features and consumed by their "scan a QR code" or "enter
+// setup key" flows.
+func otpauthURI(name string, k Key) string {
+	label := name
+	if k.issuer != "" {
+		label = k.issuer + ":" + name
+	}
+
+	otpType := "totp"
+	if k.hotp {
+		otpType = "hotp"
+	}
+	period := k.period
+	if period == 0 {
+		period = 30
+	}
+	algorithm := k.algorithm
+	if algorithm == "" {
+		algorithm = "SHA1"
+	}
+
+	v := url.Values{}
+	v.Set("secret", string(k.key))
+	v.Set("digits", strconv.Itoa(k.digits))
+	v.Set("algorithm", algorithm)
+	if k.hotp {
+		v.Set("counter", strconv.FormatUint(k.counter, 10))
+	} else {
+		v.Set("period", strconv.Itoa(period))
+	}
+	if k.issuer != "" {
+		v.Set("issuer", k.issuer)
+	}
+
+	u := url.URL{
+		Scheme:   "otpauth",
+		Host:     otpType,
+		Path:     "/" + label,
+		RawQuery: v.Encode(),
+	}
+	return u.String()
+}
+
+// parseOtpauthURI parses an otpauth://totp/ or otpauth://hotp/ URI,
+// as produced by otpauthURI or exported from an authenticator app,
+// into a key name and its Key. Missing digits defaults to 6; missing
+// period and algorithm are left at their Key zero values, meaning the
+// otpauth defaults of 30 and SHA1.
+func parseOtpauthURI(rawURI string) (name string, k Key, err error) {
+	u, err := url.Parse(rawURI)
+	if err != nil {
+		return "", Key{}, err
+	}
+	if u.Scheme != "otpauth" || (u.Host != "totp" && u.Host != "hotp") {
+		return "", Key{}, fmt.Errorf("not a TOTP or HOTP otpauth URI: %s", rawURI)
+	}
+
+	label := strings.TrimPrefix(u.Path, "/")
+	issuer := ""
+	if i := strings.Index(label, ":"); i >= 0 {
+		issuer, label = label[:i], label[i+1:]
+	}
+	name = label
+	if name == "" {
+		return "", Key{}, fmt.Errorf("otpauth URI has no key name: %s", rawURI)
+	}
+
+	q := u.Query()
+	secret := q.Get("secret")
+	if secret == "" {
+		return "", Key{}, fmt.Errorf("otpauth URI missing secret")
+	}
+
+	digits := 6
+	if d := q.Get("digits"); d != "" {
+		if digits, err = strconv.Atoi(d); err != nil {
+			return "", Key{}, fmt.Errorf("invalid digits: %v", err)
+		}
+	}
+	k = Key{digits: digits, key: []byte(secret)}
+
+	if u.Host == "hotp" {
+		k.hotp = true
+		counter, err := strconv.ParseUint(q.Get("counter"), 10, 64)
+		if err != nil {
+			return "", Key{}, fmt.Errorf("invalid counter: %v", err)
+		}
+		k.counter = counter
+	} else if p := q.Get("period"); p != "" && p != "30" {
+		period, err := strconv.Atoi(p)
+		if err != nil {
+			return "", Key{}, fmt.Errorf("invalid period: %v", err)
+		}
+		k.period = period
+	}
+	if a := q.Get("algorithm"); a != "" && a != "SHA1" {
+		k.algorithm = a
+	}
+	if iss := q.Get("issuer"); iss != "" {
+		issuer = iss
+	}
+	k.issuer = issuer
+
+	return name, k, nil
+}
@@ -0,0 +1,65 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import "testing"
+
+func TestOtpauthURIRoundTrip(t *testing.T) {
+	secret := randBase32Bytes(16)
+	for _, k := range []Key{
+		{digits: 6, key: secret},
+		{digits: 8, key: secret, period: 60, algorithm: "SHA256", issuer: "GitHub"},
+		{digits: 6, key: secret, hotp: true, counter: 42},
+		{digits: 8, key: secret, hotp: true, counter: 7, algorithm: "SHA256", issuer: "GitHub"},
+	} {
+		uri := otpauthURI("alice", k)
+		name, got, err := parseOtpauthURI(uri)
+		if err != nil {
+			t.Fatalf("parsing %q: %v", uri, err)
+		}
+		if name != "alice" {
+			t.Errorf("wrong name - Expected: alice, Actual: %s", name)
+		}
+		if got.digits != k.digits {
+			t.Errorf("wrong digits - Expected: %d, Actual: %d", k.digits, got.digits)
+		}
+		if string(got.key) != string(k.key) {
+			t.Errorf("secret mismatch - Expected: %s, Actual: %s", k.key, got.key)
+		}
+		if got.period != k.period {
+			t.Errorf("wrong period - Expected: %d, Actual: %d", k.period, got.period)
+		}
+		if got.algorithm != k.algorithm {
+			t.Errorf("wrong algorithm - Expected: %s, Actual: %s", k.algorithm, got.algorithm)
+		}
+		if got.issuer != k.issuer {
+			t.Errorf("wrong issuer - Expected: %s, Actual: %s", k.issuer, got.issuer)
+		}
+		if got.hotp != k.hotp {
+			t.Errorf("wrong hotp - Expected: %v, Actual: %v", k.hotp, got.hotp)
+		}
+		if k.hotp && got.counter != k.counter {
+			t.Errorf("wrong counter - Expected: %d, Actual: %d", k.counter, got.counter)
+		}
+	}
+}
+
+func TestParseOtpauthURIMissingSecret(t *testing.T) {
+	if _, _, err := parseOtpauthURI("otpauth://totp/alice?digits=6"); err == nil {
+		t.Error("parseOtpauthURI succeeded with no secret")
+	}
+}
+
+func TestParseOtpauthURIWrongType(t *testing.T) {
+	if _, _, err := parseOtpauthURI("otpauth://steam/alice?secret=AAAA"); err == nil {
+		t.Error("parseOtpauthURI succeeded with a non-TOTP/HOTP URI")
+	}
+}
+
+func TestParseOtpauthURIHotpMissingCounter(t *testing.T) {
+	if _, _, err := parseOtpauthURI("otpauth://hotp/alice?secret=AAAA"); err == nil {
+		t.Error("parseOtpauthURI succeeded with no counter for an HOTP URI")
+	}
+}